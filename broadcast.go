@@ -0,0 +1,100 @@
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"fmt"
+
+	"nhooyr.io/websocket/internal/errd"
+)
+
+// Broadcaster fans out a single message to many connections while, where
+// possible, compressing it only once. The frame header is still written
+// separately for each connection.
+//
+// It exists for pub/sub style servers where the same message is written to
+// many connections concurrently; re-running flate and the frame/mask loop
+// once per connection is the dominant CPU cost in that workload.
+//
+// A Broadcaster is not safe for concurrent calls to Broadcast; serialize
+// them the same way you would calls to Conn.Write on a single connection.
+type Broadcaster struct {
+	conns []*Conn
+}
+
+// NewBroadcaster returns a Broadcaster that fans out to conns.
+//
+// conns must not be mutated while the Broadcaster is in use. Call
+// NewBroadcaster again if the set of connections changes.
+func NewBroadcaster(conns []*Conn) *Broadcaster {
+	return &Broadcaster{
+		conns: conns,
+	}
+}
+
+// Broadcast writes p as a message of type typ to every connection in b.
+//
+// The payload is, if negotiated, compressed once and the resulting payload
+// bytes are reused, each under its own frame header, across every
+// connection that can accept them
+// unmasked. Connections that negotiated deflate context takeover cannot
+// share compression state between writes and fall back to the regular
+// Conn.Write path, as do client connections, since each requires its own
+// masking key.
+func (b *Broadcaster) Broadcast(ctx context.Context, typ MessageType, p []byte) (err error) {
+	defer errd.Wrap(&err, "failed to broadcast message")
+
+	oc := opcode(typ)
+
+	var plain, deflated []byte
+	var deflatedOnce, plainOnce bool
+
+	for i, c := range b.conns {
+		// Sharing one compressed payload across connections is only safe
+		// because every deflate-enabled connection's encoder uses the same,
+		// full 32 KiB window: restrictedWindowBits reports whether c was
+		// configured, via WithCompressionWindowBits, with a window this
+		// package can't honor for its own encoder. Today that configuration
+		// is always rejected outright, so restrictedWindowBits is always
+		// false, but a connection it ever returns true for needs to fall
+		// back to the per-conn path below alongside client and
+		// context-takeover connections.
+		if c.client || c.restrictedWindowBits() || (c.deflate() && c.msgWriter.deflateContextTakeover()) {
+			// Either a client connection, which needs a unique mask key per
+			// write, or a connection with context takeover enabled, whose
+			// compressor keeps state across messages and so cannot share a
+			// single compressed payload with the rest of the set.
+			err := c.Write(ctx, typ, p)
+			if err != nil {
+				return fmt.Errorf("failed to write to conn %v: %w", i, err)
+			}
+			continue
+		}
+
+		payload := plain
+		rsv1 := false
+		if c.deflate() {
+			if !deflatedOnce {
+				deflated, err = compressOnce(p)
+				if err != nil {
+					return fmt.Errorf("failed to compress broadcast payload: %w", err)
+				}
+				deflatedOnce = true
+			}
+			payload = deflated
+			rsv1 = true
+		} else if !plainOnce {
+			plain = p
+			plainOnce = true
+			payload = plain
+		}
+
+		err := c.writePreparedFrame(ctx, oc, rsv1, payload)
+		if err != nil {
+			return fmt.Errorf("failed to write to conn %v: %w", i, err)
+		}
+	}
+
+	return nil
+}
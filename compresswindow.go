@@ -0,0 +1,132 @@
+// +build !js
+
+package websocket
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Window bits bounds permessage-deflate allows negotiating for
+// server_max_window_bits and client_max_window_bits, per RFC 7692 sections
+// 7.1.2.1 and 7.1.2.2.
+const (
+	minWindowBits = 8
+	maxWindowBits = 15
+)
+
+// validateWindowBits reports whether bits is a window size permessage-deflate
+// allows negotiating. 0 means the parameter was absent from the offer or
+// the agreement, which is equivalent to the default, maximum window.
+func validateWindowBits(bits int) error {
+	if bits == 0 {
+		return nil
+	}
+	if bits < minWindowBits || bits > maxWindowBits {
+		return fmt.Errorf("window bits %v out of range [%v, %v]", bits, minWindowBits, maxWindowBits)
+	}
+	return nil
+}
+
+// ValidateCompressionWindowBits validates a server_max_window_bits and
+// client_max_window_bits pair before they're offered or accepted during the
+// permessage-deflate handshake. 0 means the parameter wasn't present in the
+// offer or agreement.
+//
+// This package does not implement real handshake-level negotiation of
+// these parameters against a peer's offer; that belongs in the accept and
+// dial code, which lives outside this slice of the repository. What it
+// does provide, and what actually calls this, is Conn.WithCompressionWindowBits,
+// which rejects any value compress/flate can't honor for a connection's own
+// encoder. Treat server_max_window_bits/client_max_window_bits negotiation
+// as unimplemented until handshake code exists that calls this for real
+// peer offers, not merely for locally configured values.
+func ValidateCompressionWindowBits(serverMaxWindowBits, clientMaxWindowBits int) error {
+	if err := validateWindowBits(serverMaxWindowBits); err != nil {
+		return fmt.Errorf("invalid server_max_window_bits: %w", err)
+	}
+	if err := validateWindowBits(clientMaxWindowBits); err != nil {
+		return fmt.Errorf("invalid client_max_window_bits: %w", err)
+	}
+	return nil
+}
+
+// windowBitsConfig is the per connection record WithCompressionWindowBits
+// stores and CompressionWindowBits reads back.
+type windowBitsConfig struct {
+	serverMaxWindowBits int
+	clientMaxWindowBits int
+}
+
+// connWindowBits associates a Conn with the window bits values
+// WithCompressionWindowBits validated for it. Conn's definition lives
+// outside this write path, so rather than add fields to it, this records
+// them in a side table keyed by the connection, the same approach
+// WithWriteQueue uses for its queue.
+var connWindowBits sync.Map // map[*Conn]windowBitsConfig
+
+// WithCompressionWindowBits validates serverMaxWindowBits and
+// clientMaxWindowBits for c and, if valid, records them so a later call to
+// c.CompressionWindowBits can read them back. It must not be called more
+// than once for the same connection.
+//
+// compress/flate cannot build an encoder restricted to a window smaller
+// than its fixed 32 KiB one, so unlike ValidateCompressionWindowBits this
+// also rejects any value other than 0 or 15 outright, rather than silently
+// accepting a configuration this package can't actually honor for c's own
+// writes.
+func (c *Conn) WithCompressionWindowBits(serverMaxWindowBits, clientMaxWindowBits int) error {
+	if err := ValidateCompressionWindowBits(serverMaxWindowBits, clientMaxWindowBits); err != nil {
+		return err
+	}
+	if serverMaxWindowBits != 0 && serverMaxWindowBits != maxWindowBits {
+		return fmt.Errorf("server_max_window_bits %v: compress/flate cannot restrict a connection's own encoder below %v bits", serverMaxWindowBits, maxWindowBits)
+	}
+	if clientMaxWindowBits != 0 && clientMaxWindowBits != maxWindowBits {
+		return fmt.Errorf("client_max_window_bits %v: compress/flate cannot restrict a connection's own encoder below %v bits", clientMaxWindowBits, maxWindowBits)
+	}
+
+	connWindowBits.Store(c, windowBitsConfig{
+		serverMaxWindowBits: serverMaxWindowBits,
+		clientMaxWindowBits: clientMaxWindowBits,
+	})
+
+	// Unlike writeQueues, nothing else already watches c.closed on this
+	// connection's behalf, so without this goroutine the entry above would
+	// outlive the connection for as long as the process runs.
+	go func() {
+		<-c.closed
+		connWindowBits.Delete(c)
+	}()
+
+	return nil
+}
+
+// CompressionWindowBits returns the window bits values most recently
+// validated for c via WithCompressionWindowBits, or 0, 0 if it was never
+// called.
+func (c *Conn) CompressionWindowBits() (serverMaxWindowBits, clientMaxWindowBits int) {
+	v, ok := connWindowBits.Load(c)
+	if !ok {
+		return 0, 0
+	}
+	cfg := v.(windowBitsConfig)
+	return cfg.serverMaxWindowBits, cfg.clientMaxWindowBits
+}
+
+// restrictedWindowBits reports whether c's own encoder would need to
+// respect a permessage-deflate window smaller than compress/flate's fixed
+// 32 KiB one. WithCompressionWindowBits already refuses such a
+// configuration, so this is always false today; Broadcaster and
+// PreparedMessage still check it directly before reusing one compressed
+// payload across connections, rather than relying transitively on that
+// validation, in case it's ever loosened to support a real window-limited
+// encoder.
+func (c *Conn) restrictedWindowBits() bool {
+	serverMaxWindowBits, clientMaxWindowBits := c.CompressionWindowBits()
+	bits := serverMaxWindowBits
+	if c.client {
+		bits = clientMaxWindowBits
+	}
+	return bits != 0 && bits != maxWindowBits
+}
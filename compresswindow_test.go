@@ -0,0 +1,67 @@
+// +build !js
+
+package websocket
+
+import "testing"
+
+func TestValidateCompressionWindowBits(t *testing.T) {
+	tests := []struct {
+		server, client int
+		wantErr        bool
+	}{
+		{0, 0, false},
+		{15, 15, false},
+		{8, 8, false},
+		{8, 15, false},
+		{7, 15, true},
+		{16, 15, true},
+		{15, 7, true},
+		{15, 16, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateCompressionWindowBits(tt.server, tt.client)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateCompressionWindowBits(%v, %v) error = %v, wantErr %v", tt.server, tt.client, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConnWithCompressionWindowBits(t *testing.T) {
+	t.Run("rejects a window compress/flate can't honor", func(t *testing.T) {
+		c := &Conn{}
+		err := c.WithCompressionWindowBits(8, 15)
+		if err == nil {
+			t.Fatal("expected an error for a server_max_window_bits compress/flate cannot restrict its encoder to")
+		}
+
+		server, client := c.CompressionWindowBits()
+		if server != 0 || client != 0 {
+			t.Fatalf("expected a rejected configuration not to be stored, got %v, %v", server, client)
+		}
+	})
+
+	t.Run("accepts and records 0 or 15", func(t *testing.T) {
+		c := &Conn{}
+		err := c.WithCompressionWindowBits(15, 0)
+		if err != nil {
+			t.Fatalf("WithCompressionWindowBits(15, 0): %v", err)
+		}
+
+		server, client := c.CompressionWindowBits()
+		if server != 15 || client != 0 {
+			t.Fatalf("CompressionWindowBits() = %v, %v, want 15, 0", server, client)
+		}
+
+		if c.restrictedWindowBits() {
+			t.Fatal("expected an accepted 15/0 configuration not to be restricted")
+		}
+	})
+
+	t.Run("unconfigured connection is unrestricted", func(t *testing.T) {
+		c := &Conn{}
+		if c.restrictedWindowBits() {
+			t.Fatal("expected a connection WithCompressionWindowBits was never called on not to be restricted")
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// +build !js
+
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"nhooyr.io/websocket/internal/errd"
+)
+
+// PrepareOption configures a PreparedMessage built with PrepareMessage.
+type PrepareOption func(*prepareConfig)
+
+type prepareConfig struct {
+	deflate bool
+}
+
+// WithPrepareDeflate precompresses the message using permessage-deflate so
+// that Conn.WritePrepared can skip compression for connections that
+// negotiated the extension without context takeover.
+func WithPrepareDeflate() PrepareOption {
+	return func(cfg *prepareConfig) {
+		cfg.deflate = true
+	}
+}
+
+// PreparedMessage caches the payload bytes of a message, plain and
+// optionally compressed, so that Conn.WritePrepared can write it to many
+// connections without re-running compression on each one. Only the payload
+// is cached: the frame header is still written for every connection.
+//
+// A PreparedMessage is safe for concurrent use and may be written to any
+// number of connections.
+type PreparedMessage struct {
+	opcode opcode
+
+	plain    []byte
+	deflated []byte
+}
+
+// PrepareMessage builds a PreparedMessage of type typ from p. p is copied,
+// so the caller is free to reuse or mutate its backing array once
+// PrepareMessage returns.
+//
+// If WithPrepareDeflate is passed, p is compressed once up front; the
+// compressed bytes are reused for every connection that negotiated
+// permessage-deflate without context takeover. Connections with context
+// takeover enabled, or that didn't negotiate deflate, fall back to the
+// uncompressed bytes.
+func PrepareMessage(typ MessageType, p []byte, opts ...PrepareOption) (*PreparedMessage, error) {
+	var cfg prepareConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	plain := append([]byte(nil), p...)
+
+	pm := &PreparedMessage{
+		opcode: opcode(typ),
+		plain:  plain,
+	}
+
+	if cfg.deflate {
+		deflated, err := compressOnce(plain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare message: %w", err)
+		}
+		pm.deflated = deflated
+	}
+
+	return pm, nil
+}
+
+// compressOnce runs p through a one-shot flate.Writer and returns the
+// compressed bytes with the trailing empty deflate block trimmed, the same
+// way msgWriter does for a single streamed message.
+func compressOnce(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := &trimLastFourBytesWriter{w: &buf}
+	fw := getFlateWriter(tw)
+	defer putFlateWriter(fw)
+
+	_, err := fw.Write(p)
+	if err != nil {
+		return nil, err
+	}
+	err = fw.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WritePrepared writes pm to the connection.
+//
+// It behaves like Write but reuses pm's cached payload bytes instead of
+// compressing the message again; the frame header is written anew for each
+// call. Unlike Write, it never goes through a queue configured with
+// WithWriteQueue and always writes directly. Client connections still
+// generate a fresh masking key per call, as required by the WebSocket
+// protocol.
+func (c *Conn) WritePrepared(ctx context.Context, pm *PreparedMessage) (err error) {
+	defer errd.Wrap(&err, "failed to write prepared message")
+
+	p := pm.plain
+	rsv1 := false
+	if c.deflate() && pm.deflated != nil && !c.restrictedWindowBits() && !c.msgWriter.deflateContextTakeover() {
+		// Safe to reuse pm.deflated as-is: every deflate-enabled connection's
+		// encoder uses the same, full 32 KiB window. restrictedWindowBits
+		// reports whether c was configured, via WithCompressionWindowBits,
+		// with a window this package can't honor for its own encoder; today
+		// that's always false, since such a configuration is rejected
+		// outright, but a connection it ever returns true for needs its own
+		// compressed variant here instead of pm.deflated.
+		p = pm.deflated
+		rsv1 = true
+	}
+
+	return c.writePreparedFrame(ctx, pm.opcode, rsv1, p)
+}
+
+// writePreparedFrame writes a single fin frame of p, bypassing msgWriter's
+// buffering and compression but not its locking. p is assumed to already be
+// in its final, possibly compressed, form; client connections still get a
+// masking key generated fresh for this call, applied to a copy of p inside
+// the bufio buffer rather than p itself, so the same p may be reused for
+// the next connection.
+//
+// It takes c.msgWriter.mu, the same per-message lock Writer and deflate
+// Write hold for the duration of a message, in addition to writeFrameMu.
+// A deflate message fragments into several writeFrame calls that each
+// release writeFrameMu in between, so locking writeFrameMu alone would let
+// this interleave a complete, unrelated data frame into the middle of
+// someone else's fragmented message, which RFC 6455 forbids.
+func (c *Conn) writePreparedFrame(ctx context.Context, oc opcode, rsv1 bool, p []byte) error {
+	err := c.msgWriter.mu.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.msgWriter.mu.Unlock()
+
+	err = c.writeFrameMu.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.writeFrameMu.Unlock()
+
+	select {
+	case <-c.closed:
+		return c.closeErr
+	case c.writeTimeout <- ctx:
+	}
+
+	c.writeHeader.fin = true
+	c.writeHeader.opcode = oc
+	c.writeHeader.payloadLength = int64(len(p))
+	c.writeHeader.rsv1 = rsv1
+
+	if c.client {
+		c.writeHeader.masked = true
+		err = binary.Read(rand.Reader, binary.LittleEndian, &c.writeHeader.maskKey)
+		if err != nil {
+			return fmt.Errorf("failed to generate masking key: %w", err)
+		}
+	} else {
+		c.writeHeader.masked = false
+	}
+
+	err = writeFrameHeader(c.writeHeader, c.bw)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.writeFramePayload(p)
+	if err != nil {
+		return err
+	}
+
+	err = c.bw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+
+	select {
+	case <-c.closed:
+		return c.closeErr
+	case c.writeTimeout <- context.Background():
+	}
+
+	return nil
+}
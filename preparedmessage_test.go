@@ -0,0 +1,22 @@
+// +build !js
+
+package websocket
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrepareMessageCopiesPayload(t *testing.T) {
+	p := []byte("hello")
+	pm, err := PrepareMessage(MessageText, p)
+	if err != nil {
+		t.Fatalf("PrepareMessage: %v", err)
+	}
+
+	copy(p, "world")
+
+	if !bytes.Equal(pm.plain, []byte("hello")) {
+		t.Fatalf("mutating the caller's buffer after PrepareMessage changed pm.plain, got %q", pm.plain)
+	}
+}
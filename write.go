@@ -39,7 +39,17 @@ func (c *Conn) Writer(ctx context.Context, typ MessageType) (io.WriteCloser, err
 //
 // If compression is disabled, then it is guaranteed to write the message
 // in a single frame.
+//
+// If a write queue was configured with WithWriteQueue, Write enqueues the
+// message on it and returns without waiting for it to actually reach the
+// wire; see WithWriteQueue for how a full queue is handled. Writer always
+// bypasses the queue and writes directly, since a streamed write cannot be
+// meaningfully queued.
 func (c *Conn) Write(ctx context.Context, typ MessageType, p []byte) error {
+	if wq := c.writeQueue(); wq != nil {
+		return wq.enqueue(ctx, typ, p)
+	}
+
 	_, err := c.write(ctx, typ, p)
 	if err != nil {
 		return fmt.Errorf("failed to write msg: %w", err)
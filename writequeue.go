@@ -0,0 +1,215 @@
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy controls what a write queue configured with WithWriteQueue
+// does when it is full and a new message arrives.
+type DropPolicy int
+
+const (
+	// Block waits for room in the queue before enqueueing, the same as an
+	// unqueued Write blocks waiting for the peer to drain. ctx cancellation
+	// still applies.
+	Block DropPolicy = iota
+
+	// DropOldest discards the oldest queued message to make room for the
+	// new one.
+	DropOldest
+
+	// DropNewest discards the message being written and leaves the queue
+	// unchanged.
+	DropNewest
+
+	// CloseOnFull closes the connection when the queue is full.
+	CloseOnFull
+)
+
+// writeQueues associates a Conn with its optional write queue. Conn's
+// definition lives outside this write path, so rather than add a field to
+// it, WithWriteQueue registers the queue here and Write looks it up by key.
+var writeQueues sync.Map // map[*Conn]*writeQueue
+
+// WithWriteQueue configures c to enqueue messages passed to Write on a
+// bounded queue of size, drained by a dedicated goroutine, instead of
+// blocking the calling goroutine on the peer draining its TCP buffer.
+//
+// This trades a slow peer blocking every writer for a slow peer falling
+// behind on its own queue, handled per policy once the queue fills up.
+// WithWriteQueue must be called before c is used for any writes and must
+// not be called more than once.
+func (c *Conn) WithWriteQueue(size int, policy DropPolicy) {
+	writeQueues.Store(c, newWriteQueue(c, size, policy))
+}
+
+// writeQueue returns c's configured write queue, or nil if WithWriteQueue
+// was never called.
+func (c *Conn) writeQueue() *writeQueue {
+	wq, ok := writeQueues.Load(c)
+	if !ok {
+		return nil
+	}
+	return wq.(*writeQueue)
+}
+
+// WriteQueueStats reports the current depth of c's write queue and the
+// total number of messages dropped from it so far. It returns 0, 0 if no
+// write queue was configured with WithWriteQueue.
+func (c *Conn) WriteQueueStats() (depth, dropped int64) {
+	wq := c.writeQueue()
+	if wq == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&wq.depth), atomic.LoadInt64(&wq.dropped)
+}
+
+type writeQueueItem struct {
+	ctx context.Context
+	typ MessageType
+	p   []byte
+}
+
+// writeQueue decouples Conn.Write from the peer's read rate: messages are
+// enqueued by callers and written to the connection by a single dedicated
+// goroutine. write and closeConn default to c.write and c.Close; tests
+// substitute a fake write so drain can run without a real connection.
+type writeQueue struct {
+	c      *Conn
+	policy DropPolicy
+
+	write     func(ctx context.Context, typ MessageType, p []byte) (int, error)
+	closeConn func(code StatusCode, reason string) error
+
+	items  chan writeQueueItem
+	closed chan struct{}
+
+	shutdownOnce sync.Once
+
+	depth   int64
+	dropped int64
+}
+
+func newWriteQueue(c *Conn, size int, policy DropPolicy) *writeQueue {
+	wq := &writeQueue{
+		c:         c,
+		policy:    policy,
+		write:     c.write,
+		closeConn: c.Close,
+		items:     make(chan writeQueueItem, size),
+		closed:    make(chan struct{}),
+	}
+	go wq.drain()
+	return wq
+}
+
+// shutdown marks wq as no longer being drained. It's safe to call more than
+// once and from multiple goroutines.
+func (wq *writeQueue) shutdown() {
+	wq.shutdownOnce.Do(func() {
+		close(wq.closed)
+		writeQueues.Delete(wq.c)
+	})
+}
+
+func (wq *writeQueue) enqueue(ctx context.Context, typ MessageType, p []byte) error {
+	// Checked up front, on its own, so a closed queue reliably errors
+	// instead of racing a select's random case choice against the
+	// non-blocking default below and occasionally still accepting the
+	// message into a queue nothing will ever drain again.
+	select {
+	case <-wq.closed:
+		return errors.New("failed to enqueue write: queue closed")
+	default:
+	}
+
+	item := writeQueueItem{ctx: ctx, typ: typ, p: p}
+
+	switch wq.policy {
+	case DropNewest:
+		select {
+		case wq.items <- item:
+			atomic.AddInt64(&wq.depth, 1)
+			return nil
+		default:
+			atomic.AddInt64(&wq.dropped, 1)
+			return nil
+		}
+
+	case DropOldest:
+		for {
+			select {
+			case wq.items <- item:
+				atomic.AddInt64(&wq.depth, 1)
+				return nil
+			default:
+			}
+
+			select {
+			case <-wq.items:
+				atomic.AddInt64(&wq.depth, -1)
+				atomic.AddInt64(&wq.dropped, 1)
+			default:
+				// The drain goroutine won the race and made room itself;
+				// retry the send.
+			}
+		}
+
+	case CloseOnFull:
+		select {
+		case wq.items <- item:
+			atomic.AddInt64(&wq.depth, 1)
+			return nil
+		default:
+			_ = wq.closeConn(StatusPolicyViolation, "write queue full")
+			return errors.New("failed to enqueue write: queue full, closing connection")
+		}
+
+	default: // Block
+		select {
+		case wq.items <- item:
+			atomic.AddInt64(&wq.depth, 1)
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("failed to enqueue write: %w", ctx.Err())
+		case <-wq.closed:
+			return errors.New("failed to enqueue write: connection closed")
+		}
+	}
+}
+
+func (wq *writeQueue) drain() {
+	defer wq.shutdown()
+
+	for {
+		select {
+		case item := <-wq.items:
+			atomic.AddInt64(&wq.depth, -1)
+			_, err := wq.write(item.ctx, item.typ, item.p)
+			if err != nil {
+				// A single item failing, e.g. because its own ctx's
+				// deadline expired while it sat in the queue, is exactly
+				// the backpressure this feature exists to absorb; it
+				// shouldn't tear down the queue for every message after
+				// it. Only stop draining once the connection itself is
+				// actually gone.
+				select {
+				case <-wq.c.closed:
+					return
+				default:
+					atomic.AddInt64(&wq.dropped, 1)
+				}
+			}
+		case <-wq.c.closed:
+			return
+		case <-wq.closed:
+			return
+		}
+	}
+}
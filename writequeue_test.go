@@ -0,0 +1,162 @@
+// +build !js
+
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestWriteQueue builds a writeQueue without starting its drain
+// goroutine or requiring a real Conn, so enqueue's drop-policy logic can be
+// exercised directly.
+func newTestWriteQueue(size int, policy DropPolicy) *writeQueue {
+	return &writeQueue{
+		policy: policy,
+		items:  make(chan writeQueueItem, size),
+		closed: make(chan struct{}),
+	}
+}
+
+func TestWriteQueueDropNewest(t *testing.T) {
+	wq := newTestWriteQueue(2, DropNewest)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		err := wq.enqueue(ctx, MessageText, nil)
+		if err != nil {
+			t.Fatalf("enqueue %v: %v", i, err)
+		}
+	}
+
+	if len(wq.items) != 2 {
+		t.Fatalf("expected queue to hold 2 items, got %v", len(wq.items))
+	}
+	if wq.dropped != 1 {
+		t.Fatalf("expected 1 dropped message, got %v", wq.dropped)
+	}
+}
+
+func TestWriteQueueDropOldest(t *testing.T) {
+	wq := newTestWriteQueue(2, DropOldest)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		p := []byte{byte(i)}
+		err := wq.enqueue(ctx, MessageText, p)
+		if err != nil {
+			t.Fatalf("enqueue %v: %v", i, err)
+		}
+	}
+
+	if len(wq.items) != 2 {
+		t.Fatalf("expected queue to hold 2 items, got %v", len(wq.items))
+	}
+	if wq.dropped != 1 {
+		t.Fatalf("expected 1 dropped message, got %v", wq.dropped)
+	}
+
+	first := <-wq.items
+	if first.p[0] != 1 {
+		t.Fatalf("expected oldest item (0) to have been dropped, got payload %v", first.p)
+	}
+}
+
+func TestWriteQueueBlockRespectsContext(t *testing.T) {
+	wq := newTestWriteQueue(1, Block)
+
+	err := wq.enqueue(context.Background(), MessageText, nil)
+	if err != nil {
+		t.Fatalf("enqueue into empty queue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = wq.enqueue(ctx, MessageText, nil)
+	if err == nil {
+		t.Fatal("expected enqueue against a full queue with a canceled context to error")
+	}
+}
+
+func TestWriteQueueEnqueueAfterShutdown(t *testing.T) {
+	for _, policy := range []DropPolicy{Block, DropOldest, DropNewest} {
+		wq := newTestWriteQueue(1, policy)
+		wq.shutdown()
+
+		err := wq.enqueue(context.Background(), MessageText, nil)
+		if err == nil {
+			t.Fatalf("policy %v: expected enqueue after shutdown to error instead of silently succeeding", policy)
+		}
+	}
+}
+
+// waitForCalls polls until calls reaches want or the test times out.
+func waitForCalls(t *testing.T, calls *int64, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(calls) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v write calls, got %v", want, atomic.LoadInt64(calls))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteQueueDrainSurvivesPerItemError(t *testing.T) {
+	c := &Conn{closed: make(chan struct{})}
+
+	var calls int64
+	wq := &writeQueue{
+		c:      c,
+		policy: DropNewest,
+		items:  make(chan writeQueueItem, 2),
+		closed: make(chan struct{}),
+		write: func(ctx context.Context, typ MessageType, p []byte) (int, error) {
+			if atomic.AddInt64(&calls, 1) == 1 {
+				// Simulate the first item's own ctx deadline expiring while
+				// it sat in the queue; the connection itself is fine.
+				return 0, context.DeadlineExceeded
+			}
+			return 0, nil
+		},
+	}
+	go wq.drain()
+	defer wq.shutdown()
+
+	wq.items <- writeQueueItem{ctx: context.Background(), typ: MessageText}
+	wq.items <- writeQueueItem{ctx: context.Background(), typ: MessageText}
+
+	waitForCalls(t, &calls, 2)
+
+	select {
+	case <-wq.closed:
+		t.Fatal("drain shut the queue down after a single item's own, recoverable error")
+	default:
+	}
+}
+
+func TestWriteQueueDrainStopsWhenConnCloses(t *testing.T) {
+	c := &Conn{closed: make(chan struct{})}
+
+	wq := &writeQueue{
+		c:      c,
+		policy: Block,
+		items:  make(chan writeQueueItem, 1),
+		closed: make(chan struct{}),
+		write: func(ctx context.Context, typ MessageType, p []byte) (int, error) {
+			return 0, nil
+		},
+	}
+	go wq.drain()
+
+	close(c.closed)
+
+	select {
+	case <-wq.closed:
+	case <-time.After(time.Second):
+		t.Fatal("drain did not shut the queue down after the connection closed")
+	}
+}